@@ -4,13 +4,19 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/gob"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -23,6 +29,28 @@ func check(err error) {
 	}
 }
 
+// saveChain writes c to path, so a later run can -load it instead of
+// re-training from the corpus.
+func saveChain(c *ShardedChain, path string) {
+	f, err := os.Create(path)
+	check(err)
+	defer f.Close()
+	_, err = c.WriteTo(f)
+	check(err)
+}
+
+// generate canonicalizes and generates from c deterministically when
+// seed is non-zero, and otherwise takes the usual non-reproducible path.
+func generate(c *ShardedChain, numWords int, seed int64) string {
+	if seed == 0 {
+		c.Prepare()
+		return c.Generate(numWords)
+	}
+	c.Canonicalize()
+	c.Prepare()
+	return c.GenerateWithRand(numWords, rand.New(rand.NewSource(seed)))
+}
+
 func FileAsWords(filename string) []string {
 	bytes, err := ioutil.ReadFile(filename)
 	check(err)
@@ -83,53 +111,375 @@ func (c *Chain) Insert(key, word string) {
 	}
 }
 
+//// -------------------- ShardedChain -------------------- ////
+// ShardedChain is a Chain with the same Insert/Build/Generate surface,
+// backed by N independently-locked shards instead of a single sync.Map.
+// Every prefix hashes to exactly one shard, so Insert under contention
+// only ever blocks goroutines that land on the same shard, and Insert
+// itself is a single locked update (an append, or a count bump for a
+// weighted chain) instead of sync.Map's Delete+LoadOrStore retry loop.
+type shard struct {
+	mu sync.RWMutex
+	m  map[string][]string  // plain/duplicate-append suffix storage
+	w  map[string]*Suffixes // weighted suffix storage (counts + alias tables)
+}
+
+type ShardedChain struct {
+	shards    []*shard
+	prefixLen int
+	weighted  bool
+}
+
+// NewShardedChain returns a new ShardedChain with prefixes of prefixLen
+// words, split across shards shards. A shards value of 0 defaults to
+// runtime.GOMAXPROCS(0)*4. It stores one suffix entry per occurrence,
+// the same as Chain.
+//
+// The shard count is fixed here rather than threaded through each Build*
+// call, unlike Chain's plain NewChain(prefixLen). That keeps NewChain and
+// its existing callers/tests untouched; ShardedChain just gets its own
+// constructor instead of NewChain growing a second, sharding-only
+// parameter.
+func NewShardedChain(prefixLen, shards int) *ShardedChain {
+	return newShardedChain(prefixLen, shards, false)
+}
+
+// NewWeightedShardedChain is like NewShardedChain, but stores suffixes as
+// (word, count) pairs instead of one entry per occurrence. Call Prepare
+// once Build finishes to precompute alias tables for O(1) sampling; until
+// Prepare runs, Generate falls back to an O(fanout) weighted scan.
+func NewWeightedShardedChain(prefixLen, shards int) *ShardedChain {
+	return newShardedChain(prefixLen, shards, true)
+}
+
+func newShardedChain(prefixLen, shards int, weighted bool) *ShardedChain {
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0) * 4
+	}
+	ss := make([]*shard, shards)
+	for i := range ss {
+		if weighted {
+			ss[i] = &shard{w: make(map[string]*Suffixes)}
+		} else {
+			ss[i] = &shard{m: make(map[string][]string)}
+		}
+	}
+	return &ShardedChain{ss, prefixLen, weighted}
+}
+
+// FNV-1a offset basis and prime, inlined so shardFor doesn't allocate a
+// hash.Hash32 on every Insert (this runs once per corpus word).
+const (
+	fnvOffset32 = 2166136261
+	fnvPrime32  = 16777619
+)
+
+func (c *ShardedChain) shardFor(key string) *shard {
+	h := uint32(fnvOffset32)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= fnvPrime32
+	}
+	return c.shards[h%uint32(len(c.shards))]
+}
+
+func (c *ShardedChain) Insert(key, word string) {
+	s := c.shardFor(key)
+	if c.weighted {
+		s.mu.Lock()
+		suf := s.w[key]
+		if suf == nil {
+			suf = &Suffixes{}
+			s.w[key] = suf
+		}
+		suf.add(word)
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Lock()
+	s.m[key] = append(s.m[key], word)
+	s.mu.Unlock()
+}
+
+// Prepare precomputes Vose's alias tables for every prefix's Suffixes so
+// Generate can sample the next word in O(1). Only meaningful on a
+// ShardedChain built with NewWeightedShardedChain; call it once Build
+// has finished inserting.
+func (c *ShardedChain) Prepare() {
+	if !c.weighted {
+		return
+	}
+	for _, s := range c.shards {
+		s.mu.Lock()
+		for _, suf := range s.w {
+			suf.buildAlias()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Canonicalize sorts every prefix's suffixes by word, so that Generate
+// and GenerateWithRand no longer depend on the order concurrent Insert
+// calls happened to race in. With a fixed seed, this makes output
+// bit-for-bit reproducible across runs and across the workers/inserters
+// matrix. Call it before Prepare, since it invalidates any existing
+// alias tables.
+func (c *ShardedChain) Canonicalize() {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		if c.weighted {
+			for _, suf := range s.w {
+				suf.sortByWord()
+			}
+		} else {
+			for key, words := range s.m {
+				sorted := append([]string(nil), words...)
+				sort.Strings(sorted)
+				s.m[key] = sorted
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+//// -------------------- Suffixes -------------------- ////
+// Suffixes holds the distinct words that follow a prefix along with how
+// many times each was observed, instead of one slice entry per
+// occurrence. Once len(words) grows past 32, add switches from a linear
+// scan to an index map so high-fanout prefixes stay cheap to update.
+type Suffixes struct {
+	words  []string
+	counts []uint32
+	total  uint64
+	index  map[string]int
+
+	// prob/alias are Vose's alias tables, built by buildAlias once the
+	// corpus is fully loaded. Both are nil until then.
+	prob  []float64
+	alias []int32
+}
+
+// add records one more occurrence of word, bumping its count if already
+// present.
+func (s *Suffixes) add(word string) {
+	if s.index != nil {
+		if i, ok := s.index[word]; ok {
+			s.counts[i]++
+			s.total++
+			return
+		}
+	} else {
+		for i, w := range s.words {
+			if w == word {
+				s.counts[i]++
+				s.total++
+				return
+			}
+		}
+	}
+
+	s.words = append(s.words, word)
+	s.counts = append(s.counts, 1)
+	s.total++
+
+	if s.index != nil {
+		s.index[word] = len(s.words) - 1
+	} else if len(s.words) > 32 {
+		s.index = make(map[string]int, len(s.words))
+		for i, w := range s.words {
+			s.index[w] = i
+		}
+	}
+}
+
+// sample picks a next word according to its observed weight. It uses the
+// alias tables when buildAlias has run, and otherwise falls back to an
+// O(fanout) weighted scan.
+func (s *Suffixes) sample() string {
+	if s.prob != nil {
+		i := rand.Intn(len(s.words))
+		if rand.Float64() < s.prob[i] {
+			return s.words[i]
+		}
+		return s.words[s.alias[i]]
+	}
+
+	r := uint64(rand.Int63n(int64(s.total)))
+	var cum uint64
+	for i, cnt := range s.counts {
+		cum += uint64(cnt)
+		if r < cum {
+			return s.words[i]
+		}
+	}
+	return s.words[len(s.words)-1]
+}
+
+// sampleWithRand is sample, but drawing from r instead of the global
+// rand source, for reproducible generation.
+func (s *Suffixes) sampleWithRand(r *rand.Rand) string {
+	if s.prob != nil {
+		i := r.Intn(len(s.words))
+		if r.Float64() < s.prob[i] {
+			return s.words[i]
+		}
+		return s.words[s.alias[i]]
+	}
+
+	roll := uint64(r.Int63n(int64(s.total)))
+	var cum uint64
+	for i, cnt := range s.counts {
+		cum += uint64(cnt)
+		if roll < cum {
+			return s.words[i]
+		}
+	}
+	return s.words[len(s.words)-1]
+}
+
+// sortByWord reorders words/counts by word so that, for a given corpus,
+// sampling no longer depends on the order concurrent Insert calls raced
+// in. It invalidates any existing alias tables; call buildAlias again
+// afterwards if O(1) sampling is needed.
+func (s *Suffixes) sortByWord() {
+	idx := make([]int, len(s.words))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return s.words[idx[i]] < s.words[idx[j]] })
+
+	words := make([]string, len(s.words))
+	counts := make([]uint32, len(s.counts))
+	for newI, oldI := range idx {
+		words[newI] = s.words[oldI]
+		counts[newI] = s.counts[oldI]
+	}
+	s.words, s.counts = words, counts
+	s.prob, s.alias = nil, nil
+
+	s.index = nil
+	if len(s.words) > 32 {
+		s.index = make(map[string]int, len(s.words))
+		for i, w := range s.words {
+			s.index[w] = i
+		}
+	}
+}
+
+// buildAlias computes Vose's alias tables (prob, alias) from counts using
+// the standard small/large partition algorithm, so sample can pick a
+// weighted word in O(1) with two rand calls.
+func (s *Suffixes) buildAlias() {
+	n := len(s.words)
+	if n == 0 {
+		return
+	}
+
+	prob := make([]float64, n)
+	alias := make([]int32, n)
+	p := make([]float64, n)
+	small := make([]int, 0, n)
+	large := make([]int, 0, n)
+
+	for i, cnt := range s.counts {
+		p[i] = float64(cnt) * float64(n) / float64(s.total)
+		if p[i] < 1 {
+			small = append(small, i)
+		} else {
+			large = append(large, i)
+		}
+	}
+
+	for len(small) > 0 && len(large) > 0 {
+		sIdx := small[len(small)-1]
+		small = small[:len(small)-1]
+		lIdx := large[len(large)-1]
+		large = large[:len(large)-1]
+
+		prob[sIdx] = p[sIdx]
+		alias[sIdx] = int32(lIdx)
+
+		p[lIdx] -= 1 - p[sIdx]
+		if p[lIdx] < 1 {
+			small = append(small, lIdx)
+		} else {
+			large = append(large, lIdx)
+		}
+	}
+
+	for len(large) > 0 {
+		lIdx := large[len(large)-1]
+		large = large[:len(large)-1]
+		prob[lIdx] = 1
+	}
+	for len(small) > 0 {
+		sIdx := small[len(small)-1]
+		small = small[:len(small)-1]
+		prob[sIdx] = 1
+	}
+
+	s.prob = prob
+	s.alias = alias
+}
+
 //////// -------------------- BUILD -------------------- ////////
-func (c *Chain) Build(words []string, workers, inserters int) {
+// inserter is the common surface Chain and ShardedChain both satisfy, so
+// the fan-out/thread-pool build strategies below only need to be written
+// once and are shared by every concurrent map backing.
+type inserter interface {
+	Insert(key, word string)
+}
+
+func buildSeq(c inserter, prefixLen int, words []string) {
+	// Simple sequential implementation
+	p := make(Prefix, prefixLen)
+	for _, word := range words {
+		key := p.String()
+		c.Insert(key, word)
+		p.Shift(word)
+	}
+}
+
+func build(c inserter, prefixLen int, words []string, workers, inserters int) {
 	switch workers {
 	case 1:
-		// Simple sequential implementation
-		p := make(Prefix, c.prefixLen)
-		for _, word := range words {
-			key := p.String()
-			c.Insert(key, word)
-			p.Shift(word)
-		}
+		buildSeq(c, prefixLen, words)
 	case 0:
-		c.BuildGo(words, inserters)
+		buildGo(c, prefixLen, words, inserters)
 	default:
-		c.BuildTP(words, workers, inserters)
+		buildTP(c, prefixLen, words, workers, inserters)
 	}
 }
 
 //// -------------------- Goroutines -------------------- ////
 // Spawns goroutines per prefix-word pair
-func (c *Chain) BuildGo(words []string, inserters int) {
+func buildGo(c inserter, prefixLen int, words []string, inserters int) {
 	switch inserters {
 	case 0:
-		c.BuildGoLock(words) // Fine-grain locks
+		buildGoLock(c, prefixLen, words) // Fine-grain locks
 	case 1:
-		c.BuildGoChannel(words) // One channel
+		buildGoChannel(c, prefixLen, words) // One channel
 	default:
-		c.BuildGoChannels(words, inserters) // "inserters" channels
+		buildGoChannels(c, prefixLen, words, inserters) // "inserters" channels
 	}
 }
 
-func (c *Chain) BuildGoLock(words []string) {
+func buildGoLock(c inserter, prefixLen int, words []string) {
 	var wg sync.WaitGroup
 
 	// Take care of first edge cases
-	p := make(Prefix, c.prefixLen)
-	for _, word := range words[:c.prefixLen] {
+	p := make(Prefix, prefixLen)
+	for _, word := range words[:prefixLen] {
 		key := p.String()
 		c.Insert(key, word)
 		p.Shift(word)
 	}
 
-	for idx := c.prefixLen; idx < len(words); idx++ {
+	for idx := prefixLen; idx < len(words); idx++ {
 		wg.Add(1)
 		// Do work
 		go func(words []string, idx int) {
-			key := strings.Join(words[idx-c.prefixLen:idx], " ")
+			key := strings.Join(words[idx-prefixLen:idx], " ")
 			c.Insert(key, words[idx])
 			wg.Done()
 		}(words, idx)
@@ -138,23 +488,23 @@ func (c *Chain) BuildGoLock(words []string) {
 	wg.Wait()
 }
 
-func (c *Chain) BuildGoChannel(words []string) {
+func buildGoChannel(c inserter, prefixLen int, words []string) {
 	ch := make(chan pair, 8)
 	var wg sync.WaitGroup
 
 	// Take care of first edge cases
-	p := make(Prefix, c.prefixLen)
-	for _, word := range words[:c.prefixLen] {
+	p := make(Prefix, prefixLen)
+	for _, word := range words[:prefixLen] {
 		key := p.String()
 		ch <- pair{key, word}
 		p.Shift(word)
 	}
 
-	for idx := c.prefixLen; idx < len(words); idx++ {
+	for idx := prefixLen; idx < len(words); idx++ {
 		wg.Add(1)
 		// Do work
 		go func(words []string, idx int) {
-			key := strings.Join(words[idx-c.prefixLen:idx], " ")
+			key := strings.Join(words[idx-prefixLen:idx], " ")
 			ch <- pair{key, words[idx]}
 			wg.Done()
 		}(words, idx)
@@ -174,23 +524,23 @@ func (c *Chain) BuildGoChannel(words []string) {
 	wg.Wait()
 }
 
-func (c *Chain) BuildGoChannels(words []string, inserters int) {
+func buildGoChannels(c inserter, prefixLen int, words []string, inserters int) {
 	ch := make(chan pair, 8)
 	var wg sync.WaitGroup
 
 	// Take care of first edge cases
-	p := make(Prefix, c.prefixLen)
-	for _, word := range words[:c.prefixLen] {
+	p := make(Prefix, prefixLen)
+	for _, word := range words[:prefixLen] {
 		key := p.String()
 		ch <- pair{key, word}
 		p.Shift(word)
 	}
 
-	for idx := c.prefixLen; idx < len(words); idx++ {
+	for idx := prefixLen; idx < len(words); idx++ {
 		wg.Add(1)
 		// Do work
 		go func(words []string, idx int) {
-			key := strings.Join(words[idx-c.prefixLen:idx], " ")
+			key := strings.Join(words[idx-prefixLen:idx], " ")
 			ch <- pair{key, words[idx]}
 			wg.Done()
 		}(words, idx)
@@ -214,18 +564,18 @@ func (c *Chain) BuildGoChannels(words []string, inserters int) {
 
 //// -------------------- Thread-Pool -------------------- ////
 // Evenly partitions text between workers (so not really a thread pool)
-func (c *Chain) BuildTP(words []string, workers, inserters int) {
+func buildTP(c inserter, prefixLen int, words []string, workers, inserters int) {
 	switch inserters {
 	case 0:
-		c.BuildTPLock(words, workers) // fine-grain lock
+		buildTPLock(c, prefixLen, words, workers) // fine-grain lock
 	case 1:
-		c.BuildTPChannel(words, workers) // One channel
+		buildTPChannel(c, prefixLen, words, workers) // One channel
 	default:
-		c.BuildTPChannels(words, workers, inserters) // "inserters" channels
+		buildTPChannels(c, prefixLen, words, workers, inserters) // "inserters" channels
 	}
 }
 
-func (c *Chain) BuildTPLock(words []string, workers int) {
+func buildTPLock(c inserter, prefixLen int, words []string, workers int) {
 	var wg sync.WaitGroup
 	wg.Add(workers)
 
@@ -238,11 +588,11 @@ func (c *Chain) BuildTPLock(words []string, workers int) {
 		end := min(perWorker*(i+1), len(words))
 		go func(words []string, start, end int) {
 			// Initialize Prefix
-			p := make(Prefix, c.prefixLen)
+			p := make(Prefix, prefixLen)
 			if start != 0 {
-				for idx := 0; idx < c.prefixLen; idx++ {
+				for idx := 0; idx < prefixLen; idx++ {
 					// There is a dumb case where this Index Out of Bounds
-					p[idx] = words[start+idx-c.prefixLen]
+					p[idx] = words[start+idx-prefixLen]
 				}
 			}
 
@@ -259,7 +609,7 @@ func (c *Chain) BuildTPLock(words []string, workers int) {
 	wg.Wait()
 }
 
-func (c *Chain) BuildTPChannel(words []string, workers int) {
+func buildTPChannel(c inserter, prefixLen int, words []string, workers int) {
 	ch := make(chan pair, workers)
 	var wg sync.WaitGroup
 	wg.Add(workers)
@@ -273,11 +623,11 @@ func (c *Chain) BuildTPChannel(words []string, workers int) {
 		end := min(perWorker*(i+1), len(words))
 		go func(words []string, start, end int) {
 			// Initialize Prefix
-			p := make(Prefix, c.prefixLen)
+			p := make(Prefix, prefixLen)
 			if start != 0 {
-				for idx := 0; idx < c.prefixLen; idx++ {
+				for idx := 0; idx < prefixLen; idx++ {
 					// There is a dumb case where this Index Out of Bounds
-					p[idx] = words[start+idx-c.prefixLen]
+					p[idx] = words[start+idx-prefixLen]
 				}
 			}
 
@@ -305,7 +655,7 @@ func (c *Chain) BuildTPChannel(words []string, workers int) {
 	wg.Wait()
 }
 
-func (c *Chain) BuildTPChannels(words []string, workers, inserters int) {
+func buildTPChannels(c inserter, prefixLen int, words []string, workers, inserters int) {
 	ch := make(chan pair, workers)
 	var wg sync.WaitGroup
 	wg.Add(workers)
@@ -319,11 +669,11 @@ func (c *Chain) BuildTPChannels(words []string, workers, inserters int) {
 		end := min(perWorker*(i+1), len(words))
 		go func(words []string, start, end int) {
 			// Initialize Prefix
-			p := make(Prefix, c.prefixLen)
+			p := make(Prefix, prefixLen)
 			if start != 0 {
-				for idx := 0; idx < c.prefixLen; idx++ {
+				for idx := 0; idx < prefixLen; idx++ {
 					// There is a dumb case where this Index Out of Bounds
-					p[idx] = words[start+idx-c.prefixLen]
+					p[idx] = words[start+idx-prefixLen]
 				}
 			}
 
@@ -353,6 +703,42 @@ func (c *Chain) BuildTPChannels(words []string, workers, inserters int) {
 	wg.Wait()
 }
 
+func (c *Chain) Build(words []string, workers, inserters int) {
+	build(c, c.prefixLen, words, workers, inserters)
+}
+
+func (c *Chain) BuildGo(words []string, inserters int) {
+	buildGo(c, c.prefixLen, words, inserters)
+}
+
+func (c *Chain) BuildGoLock(words []string) {
+	buildGoLock(c, c.prefixLen, words)
+}
+
+func (c *Chain) BuildGoChannel(words []string) {
+	buildGoChannel(c, c.prefixLen, words)
+}
+
+func (c *Chain) BuildGoChannels(words []string, inserters int) {
+	buildGoChannels(c, c.prefixLen, words, inserters)
+}
+
+func (c *Chain) BuildTP(words []string, workers, inserters int) {
+	buildTP(c, c.prefixLen, words, workers, inserters)
+}
+
+func (c *Chain) BuildTPLock(words []string, workers int) {
+	buildTPLock(c, c.prefixLen, words, workers)
+}
+
+func (c *Chain) BuildTPChannel(words []string, workers int) {
+	buildTPChannel(c, c.prefixLen, words, workers)
+}
+
+func (c *Chain) BuildTPChannels(words []string, workers, inserters int) {
+	buildTPChannels(c, c.prefixLen, words, workers, inserters)
+}
+
 // Generate returns a string of at most n words generated from Chain.
 func (c *Chain) Generate(n int) string {
 	p := make(Prefix, c.prefixLen)
@@ -370,6 +756,325 @@ func (c *Chain) Generate(n int) string {
 	return strings.Join(words, " ")
 }
 
+//////// -------------------- ShardedChain BUILD -------------------- ////////
+func (c *ShardedChain) Build(words []string, workers, inserters int) {
+	build(c, c.prefixLen, words, workers, inserters)
+}
+
+func (c *ShardedChain) BuildGo(words []string, inserters int) {
+	buildGo(c, c.prefixLen, words, inserters)
+}
+
+func (c *ShardedChain) BuildGoLock(words []string) {
+	buildGoLock(c, c.prefixLen, words)
+}
+
+func (c *ShardedChain) BuildGoChannel(words []string) {
+	buildGoChannel(c, c.prefixLen, words)
+}
+
+func (c *ShardedChain) BuildGoChannels(words []string, inserters int) {
+	buildGoChannels(c, c.prefixLen, words, inserters)
+}
+
+func (c *ShardedChain) BuildTP(words []string, workers, inserters int) {
+	buildTP(c, c.prefixLen, words, workers, inserters)
+}
+
+func (c *ShardedChain) BuildTPLock(words []string, workers int) {
+	buildTPLock(c, c.prefixLen, words, workers)
+}
+
+func (c *ShardedChain) BuildTPChannel(words []string, workers int) {
+	buildTPChannel(c, c.prefixLen, words, workers)
+}
+
+func (c *ShardedChain) BuildTPChannels(words []string, workers, inserters int) {
+	buildTPChannels(c, c.prefixLen, words, workers, inserters)
+}
+
+//// -------------------- Streaming -------------------- ////
+// prefixWord is a (prefix snapshot, word) pair flowing out of the reader
+// stage of BuildStream, before the prefix has been joined into a key.
+type prefixWord struct {
+	prefix []string
+	word   string
+}
+
+// BuildStream trains the chain from r without ever materializing the
+// full corpus as a []string, so corpora larger than available memory
+// can still be used. It runs a three-stage fan-out/fan-in pipeline: one
+// reader goroutine scans words and maintains the rolling Prefix window,
+// `workers` goroutines join each prefix snapshot into a key, and
+// `inserters` goroutines call Insert. ctx cancellation stops all three
+// stages early; BuildStream returns the first error encountered,
+// including ctx.Err().
+func (c *ShardedChain) BuildStream(ctx context.Context, r io.Reader, workers, inserters int) error {
+	if workers <= 0 {
+		workers = 1
+	}
+	if inserters <= 0 {
+		inserters = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	rawCh := make(chan prefixWord, 64)
+	keyCh := make(chan pair, 64)
+
+	var scanErr error
+	scanDone := make(chan struct{})
+	go func() {
+		defer close(rawCh)
+		defer close(scanDone)
+
+		scanner := bufio.NewScanner(r)
+		scanner.Split(bufio.ScanWords)
+		p := make(Prefix, c.prefixLen)
+		for scanner.Scan() {
+			word := scanner.Text()
+			snapshot := append([]string(nil), p...)
+			select {
+			case rawCh <- prefixWord{snapshot, word}:
+			case <-ctx.Done():
+				return
+			}
+			p.Shift(word)
+		}
+		scanErr = scanner.Err()
+	}()
+
+	var hashWG sync.WaitGroup
+	hashWG.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer hashWG.Done()
+			for pw := range rawCh {
+				key := strings.Join(pw.prefix, " ")
+				select {
+				case keyCh <- pair{key, pw.word}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		hashWG.Wait()
+		close(keyCh)
+	}()
+
+	var insWG sync.WaitGroup
+	insWG.Add(inserters)
+	for i := 0; i < inserters; i++ {
+		go func() {
+			defer insWG.Done()
+			for kw := range keyCh {
+				c.Insert(kw.a, kw.b)
+			}
+		}()
+	}
+	insWG.Wait()
+	<-scanDone
+
+	if scanErr != nil {
+		return scanErr
+	}
+	return ctx.Err()
+}
+
+// BuildStreamMulti logically concatenates readers into a single corpus,
+// resetting the Prefix window at the start of each one, so a directory
+// of files can be trained on without first cating them together.
+func (c *ShardedChain) BuildStreamMulti(ctx context.Context, readers []io.Reader, workers, inserters int) error {
+	for _, r := range readers {
+		if err := c.BuildStream(ctx, r, workers, inserters); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//// -------------------- Persistence -------------------- ////
+// chainFormatVersion is the first byte of every WriteTo stream, so a
+// future incompatible format change can be detected by ReadChain instead
+// of failing deep inside gob decoding.
+const chainFormatVersion byte = 1
+
+// gobSuffixes is the on-disk form of one prefix's Suffixes. Counts is nil
+// for a non-weighted ShardedChain, where Words holds one entry per
+// occurrence instead of per distinct word. Prob/Alias are only populated
+// if Prepare had already run at save time.
+type gobSuffixes struct {
+	Prefix string
+	Words  []string
+	Counts []uint32
+	Prob   []float64
+	Alias  []int32
+}
+
+type gobChain struct {
+	PrefixLen int
+	Shards    int
+	Weighted  bool
+	Entries   []gobSuffixes
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// WriteTo gob-encodes c and writes it to w, preceded by a version byte.
+// If Prepare has already been run, the alias tables are saved alongside
+// the counts so ReadChain doesn't have to rebuild them.
+func (c *ShardedChain) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	if _, err := cw.Write([]byte{chainFormatVersion}); err != nil {
+		return cw.n, err
+	}
+
+	gc := gobChain{PrefixLen: c.prefixLen, Shards: len(c.shards), Weighted: c.weighted}
+	for _, s := range c.shards {
+		s.mu.RLock()
+		if c.weighted {
+			for prefix, suf := range s.w {
+				gc.Entries = append(gc.Entries, gobSuffixes{
+					Prefix: prefix,
+					Words:  suf.words,
+					Counts: suf.counts,
+					Prob:   suf.prob,
+					Alias:  suf.alias,
+				})
+			}
+		} else {
+			for prefix, words := range s.m {
+				gc.Entries = append(gc.Entries, gobSuffixes{Prefix: prefix, Words: words})
+			}
+		}
+		s.mu.RUnlock()
+	}
+
+	err := gob.NewEncoder(cw).Encode(gc)
+	return cw.n, err
+}
+
+// ReadChain reads a ShardedChain previously written by WriteTo. The
+// shard count and hashing scheme are restored exactly as saved, so
+// ReadChain followed by Generate reproduces the trained chain without
+// re-running Build.
+func ReadChain(r io.Reader) (*ShardedChain, error) {
+	var version [1]byte
+	if _, err := io.ReadFull(r, version[:]); err != nil {
+		return nil, err
+	}
+	if version[0] != chainFormatVersion {
+		return nil, fmt.Errorf("parallelmarkov: unsupported chain format version %d", version[0])
+	}
+
+	var gc gobChain
+	if err := gob.NewDecoder(r).Decode(&gc); err != nil {
+		return nil, err
+	}
+
+	c := newShardedChain(gc.PrefixLen, gc.Shards, gc.Weighted)
+	for _, e := range gc.Entries {
+		s := c.shardFor(e.Prefix)
+		if gc.Weighted {
+			suf := &Suffixes{words: e.Words, counts: e.Counts, prob: e.Prob, alias: e.Alias}
+			for _, cnt := range e.Counts {
+				suf.total += uint64(cnt)
+			}
+			if len(suf.words) > 32 {
+				suf.index = make(map[string]int, len(suf.words))
+				for i, word := range suf.words {
+					suf.index[word] = i
+				}
+			}
+			s.w[e.Prefix] = suf
+		} else {
+			s.m[e.Prefix] = e.Words
+		}
+	}
+	return c, nil
+}
+
+// Generate returns a string of at most n words generated from ShardedChain.
+func (c *ShardedChain) Generate(n int) string {
+	p := make(Prefix, c.prefixLen)
+	var words []string
+	for i := 0; i < n; i++ {
+		key := p.String()
+		s := c.shardFor(key)
+
+		var next string
+		if c.weighted {
+			s.mu.RLock()
+			suf := s.w[key]
+			s.mu.RUnlock()
+			if suf == nil {
+				break
+			}
+			next = suf.sample()
+		} else {
+			s.mu.RLock()
+			choices := s.m[key]
+			s.mu.RUnlock()
+			if choices == nil {
+				break
+			}
+			next = choices[rand.Intn(len(choices))]
+		}
+
+		words = append(words, next)
+		p.Shift(next)
+	}
+	return strings.Join(words, " ")
+}
+
+// GenerateWithRand is Generate, but sampling from r instead of the
+// global rand source. Combined with Canonicalize, it makes generation
+// reproducible for a given seed and corpus, independent of how the
+// chain was built.
+func (c *ShardedChain) GenerateWithRand(n int, r *rand.Rand) string {
+	p := make(Prefix, c.prefixLen)
+	var words []string
+	for i := 0; i < n; i++ {
+		key := p.String()
+		s := c.shardFor(key)
+
+		var next string
+		if c.weighted {
+			s.mu.RLock()
+			suf := s.w[key]
+			s.mu.RUnlock()
+			if suf == nil {
+				break
+			}
+			next = suf.sampleWithRand(r)
+		} else {
+			s.mu.RLock()
+			choices := s.m[key]
+			s.mu.RUnlock()
+			if choices == nil {
+				break
+			}
+			next = choices[r.Intn(len(choices))]
+		}
+
+		words = append(words, next)
+		p.Shift(next)
+	}
+	return strings.Join(words, " ")
+}
+
 func main() {
 	// Register command-line flags.
 	numWords := flag.Int("words", 100, "maximum number of words to print")
@@ -381,6 +1086,18 @@ func main() {
 	inputFile := flag.String("input", "", "Input file path")
 	// outputFile := flag.String("output", "out.txt", "Output file path")
 
+	sharded := flag.Bool("sharded", false, "use the sharded concurrent map instead of sync.Map")
+	shards := flag.Int("shards", 0, "number of shards for -sharded (0 = GOMAXPROCS(0)*4)")
+	weighted := flag.Bool("weighted", false, "store suffixes as (word, count) pairs with alias-table sampling instead of one entry per occurrence (requires -sharded)")
+
+	stream := flag.Bool("stream", false, "train with BuildStream instead of reading the whole corpus into memory first (implies -sharded)")
+	inputGlob := flag.String("input-glob", "", "glob of input files to train from with -stream, read in logical sequence instead of -input")
+
+	savePath := flag.String("save", "", "write the trained chain to this path (implies -sharded)")
+	loadPath := flag.String("load", "", "load a chain saved with -save instead of training from -input (implies -sharded)")
+
+	seed := flag.Int64("seed", 0, "seed for reproducible generation, bit-for-bit across runs and across the workers/inserters matrix (implies -sharded; 0 = non-deterministic)")
+
 	// Set up output
 	// output, err := os.Open(*outputFile)
 	// check(err)
@@ -391,20 +1108,104 @@ func main() {
 	flag.Parse()                     // Parse command-line flags.
 	rand.Seed(time.Now().UnixNano()) // Seed the random number generator.
 
-	words := FileAsWords(*inputFile)
-	c := NewChain(*prefixLen) // Initialize a new Chain.
+	if *savePath != "" || *loadPath != "" || *seed != 0 {
+		*sharded = true // only ShardedChain implements WriteTo/ReadChain/GenerateWithRand
+	}
 
 	debug.SetGCPercent(-1)
 	runtime.GC()
 
-	///// Where the magic happens /////
-	start := time.Now()
-	c.Build(words, *workers, *inserters)
-	elapsed := time.Since(start)
-	///// Where the magic happens /////
+	var elapsed time.Duration
+	var text string
+
+	if *loadPath != "" {
+		f, err := os.Open(*loadPath)
+		check(err)
+		defer f.Close()
+
+		start := time.Now()
+		c, err := ReadChain(f)
+		check(err)
+		elapsed = time.Since(start)
+
+		fmt.Fprintf(dataFile, "%.6f,", elapsed.Seconds())
+		fmt.Println(generate(c, *numWords, *seed))
+		return
+	}
+
+	if *stream {
+		var c *ShardedChain
+		if *weighted {
+			c = NewWeightedShardedChain(*prefixLen, *shards)
+		} else {
+			c = NewShardedChain(*prefixLen, *shards)
+		}
+
+		paths := []string{*inputFile}
+		if *inputGlob != "" {
+			paths, err = filepath.Glob(*inputGlob)
+			check(err)
+		}
+		readers := make([]io.Reader, len(paths))
+		for i, path := range paths {
+			f, err := os.Open(path)
+			check(err)
+			defer f.Close()
+			readers[i] = f
+		}
+
+		///// Where the magic happens /////
+		start := time.Now()
+		check(c.BuildStreamMulti(context.Background(), readers, *workers, *inserters))
+		elapsed = time.Since(start)
+		///// Where the magic happens /////
+
+		text = generate(c, *numWords, *seed)
+
+		if *savePath != "" {
+			saveChain(c, *savePath)
+		}
+
+		fmt.Fprintf(dataFile, "%.6f,", elapsed.Seconds())
+		fmt.Println(text)
+		return
+	}
+
+	words := FileAsWords(*inputFile)
+
+	if *sharded {
+		var c *ShardedChain
+		if *weighted {
+			c = NewWeightedShardedChain(*prefixLen, *shards)
+		} else {
+			c = NewShardedChain(*prefixLen, *shards)
+		}
+
+		///// Where the magic happens /////
+		start := time.Now()
+		c.Build(words, *workers, *inserters)
+		elapsed = time.Since(start)
+		///// Where the magic happens /////
+
+		text = generate(c, *numWords, *seed)
+
+		if *savePath != "" {
+			saveChain(c, *savePath)
+		}
+	} else {
+		c := NewChain(*prefixLen) // Initialize a new Chain.
+
+		///// Where the magic happens /////
+		start := time.Now()
+		c.Build(words, *workers, *inserters)
+		elapsed = time.Since(start)
+		///// Where the magic happens /////
+
+		text = c.Generate(*numWords)
+	}
 
 	fmt.Fprintf(dataFile, "%.6f,", elapsed.Seconds())
 
-	fmt.Println(c.Generate(*numWords)) // Generate text.
+	fmt.Println(text) // Generate text.
 	// fmt.Fprintln(output, text)    // Write text to standard output.
 }
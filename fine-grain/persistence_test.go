@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteToReadChainRoundTrip(t *testing.T) {
+	prefixLen := 2
+	words := FileAsWords("simple.txt")
+
+	c := NewShardedChain(prefixLen, 4)
+	c.Build(words, 4, 4)
+
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	loaded, err := ReadChain(&buf)
+	if err != nil {
+		t.Fatalf("ReadChain: %v", err)
+	}
+
+	if !Equal(shardedMap(loaded), shardedMap(c)) {
+		t.Fatalf("chain read back from WriteTo differs from the original")
+	}
+}
+
+func TestWriteToReadChainRoundTripWeighted(t *testing.T) {
+	prefixLen := 2
+	words := FileAsWords("simple.txt")
+
+	c := NewWeightedShardedChain(prefixLen, 4)
+	c.Build(words, 4, 4)
+	c.Prepare()
+
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	loaded, err := ReadChain(&buf)
+	if err != nil {
+		t.Fatalf("ReadChain: %v", err)
+	}
+
+	if !Equal(weightedMap(loaded), weightedMap(c)) {
+		t.Fatalf("weighted chain read back from WriteTo differs from the original")
+	}
+}
+
+func TestReadChainRejectsUnknownVersion(t *testing.T) {
+	buf := bytes.NewBuffer([]byte{chainFormatVersion + 1})
+	if _, err := ReadChain(buf); err == nil {
+		t.Fatalf("expected an error for an unsupported format version")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func shardedMap(c *ShardedChain) map[string][]string {
+	m := make(map[string][]string)
+	for _, s := range c.shards {
+		s.mu.RLock()
+		for k, v := range s.m {
+			m[k] = v
+		}
+		s.mu.RUnlock()
+	}
+	return m
+}
+
+func RunShardedTest(t *testing.T, workers, inserters int) {
+	prefixLen := 2
+	words := FileAsWords("simple.txt")
+	c := NewShardedChain(prefixLen, 0)
+	c.Build(words, workers, inserters)
+	cmap := shardedMap(c)
+	if !Equal(cmap, correct) {
+		fmt.Printf("Fail with %d workers, %d inserters\n", workers, inserters)
+		printMap(cmap)
+		printMap(correct)
+		t.Fail()
+	}
+}
+
+func TestShardedSimple(t *testing.T) {
+	RunShardedTest(t, 1, 0)
+}
+
+func TestShardedGoLock(t *testing.T) {
+	RunShardedTest(t, 0, 0)
+}
+
+func TestShardedGoChannel(t *testing.T) {
+	RunShardedTest(t, 0, 1)
+}
+
+func TestShardedGoChannels(t *testing.T) {
+	RunShardedTest(t, 0, 4)
+}
+
+func TestShardedTPLock(t *testing.T) {
+	RunShardedTest(t, 4, 0)
+}
+
+func TestShardedTPChannel(t *testing.T) {
+	RunShardedTest(t, 4, 1)
+}
+
+func TestShardedTPChannels(t *testing.T) {
+	RunShardedTest(t, 4, 4)
+}
+
+// randomWords builds a synthetic corpus so the benchmarks below don't
+// depend on a fixture file being present on disk.
+func randomWords(n, vocab int) []string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = "w" + strconv.Itoa(rand.Intn(vocab))
+	}
+	return words
+}
+
+func BenchmarkChainGoLock(b *testing.B) {
+	words := randomWords(20000, 50)
+	for i := 0; i < b.N; i++ {
+		c := NewChain(2)
+		c.BuildGoLock(words)
+	}
+}
+
+func BenchmarkShardedChainGoLock(b *testing.B) {
+	words := randomWords(20000, 50)
+	for i := 0; i < b.N; i++ {
+		c := NewShardedChain(2, 0)
+		c.BuildGoLock(words)
+	}
+}
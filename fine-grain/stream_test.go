@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBuildStream(t *testing.T) {
+	prefixLen := 2
+	words := FileAsWords("simple.txt")
+	r := strings.NewReader(strings.Join(words, " "))
+
+	c := NewShardedChain(prefixLen, 0)
+	if err := c.BuildStream(context.Background(), r, 4, 4); err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(shardedMap(c), correct) {
+		t.Fatalf("BuildStream produced a different chain than the in-memory Build")
+	}
+}
+
+func TestBuildStreamMultiResetsPrefixWindow(t *testing.T) {
+	c := NewShardedChain(2, 0)
+	readers := []io.Reader{
+		strings.NewReader("alpha beta gamma"),
+		strings.NewReader("delta epsilon zeta"),
+	}
+	if err := c.BuildStreamMulti(context.Background(), readers, 2, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	m := shardedMap(c)
+	if _, ok := m["gamma delta"]; ok {
+		t.Fatalf("expected prefix window to reset between readers, but found a cross-reader transition")
+	}
+	restarted := false
+	for _, w := range m[" "] {
+		if w == "delta" {
+			restarted = true
+		}
+	}
+	if !restarted {
+		t.Fatalf("expected the second reader to restart from the empty prefix")
+	}
+}
+
+func TestBuildStreamPropagatesScanError(t *testing.T) {
+	c := NewShardedChain(2, 0)
+	wantErr := errors.New("boom")
+	if err := c.BuildStream(context.Background(), errReader{wantErr}, 2, 2); !errors.Is(err, wantErr) {
+		t.Fatalf("BuildStream error = %v, want %v", err, wantErr)
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
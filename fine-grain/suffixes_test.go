@@ -0,0 +1,122 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func weightedMap(c *ShardedChain) map[string][]string {
+	m := make(map[string][]string)
+	for _, s := range c.shards {
+		s.mu.RLock()
+		for k, suf := range s.w {
+			words := append([]string(nil), suf.words...)
+			sort.Strings(words)
+			m[k] = words
+		}
+		s.mu.RUnlock()
+	}
+	return m
+}
+
+// correctWords is the same fixture as correct, but with duplicate
+// suffixes collapsed since the weighted path stores one entry per
+// distinct word rather than one per occurrence.
+func correctWords() map[string][]string {
+	m := make(map[string][]string)
+	for k, v := range correct {
+		seen := make(map[string]bool)
+		var words []string
+		for _, w := range v {
+			if !seen[w] {
+				seen[w] = true
+				words = append(words, w)
+			}
+		}
+		sort.Strings(words)
+		m[k] = words
+	}
+	return m
+}
+
+func RunWeightedTest(t *testing.T, workers, inserters int) {
+	prefixLen := 2
+	words := FileAsWords("simple.txt")
+	c := NewWeightedShardedChain(prefixLen, 0)
+	c.Build(words, workers, inserters)
+	if !Equal(weightedMap(c), correctWords()) {
+		t.Fatalf("weighted chain mismatch with %d workers, %d inserters", workers, inserters)
+	}
+}
+
+func TestWeightedSimple(t *testing.T) {
+	RunWeightedTest(t, 1, 0)
+}
+
+func TestWeightedTPChannels(t *testing.T) {
+	RunWeightedTest(t, 4, 4)
+}
+
+func TestSuffixesAddCountsDuplicates(t *testing.T) {
+	s := &Suffixes{}
+	s.add("cat")
+	s.add("dog")
+	s.add("cat")
+
+	if s.total != 3 {
+		t.Fatalf("total = %d, want 3", s.total)
+	}
+	if len(s.words) != 2 {
+		t.Fatalf("len(words) = %d, want 2", len(s.words))
+	}
+	for i, w := range s.words {
+		if w == "cat" && s.counts[i] != 2 {
+			t.Fatalf("counts[cat] = %d, want 2", s.counts[i])
+		}
+		if w == "dog" && s.counts[i] != 1 {
+			t.Fatalf("counts[dog] = %d, want 1", s.counts[i])
+		}
+	}
+}
+
+func TestSuffixesAddFallsBackToIndex(t *testing.T) {
+	s := &Suffixes{}
+	for i := 0; i < 40; i++ {
+		s.add(strconv.Itoa(i))
+	}
+	if s.index == nil {
+		t.Fatalf("expected index to be built past 32 distinct words")
+	}
+	s.add("0")
+	if i, ok := s.index["0"]; !ok || s.words[i] != "0" {
+		t.Fatalf("index lookup for existing word broken")
+	}
+}
+
+func TestSuffixesBuildAliasProbabilitiesInRange(t *testing.T) {
+	s := &Suffixes{}
+	s.add("a")
+	s.add("b")
+	s.add("b")
+	s.add("c")
+	s.add("c")
+	s.add("c")
+	s.buildAlias()
+
+	if len(s.prob) != len(s.words) || len(s.alias) != len(s.words) {
+		t.Fatalf("alias tables have wrong length")
+	}
+	for i, p := range s.prob {
+		if p < 0 || p > 1 {
+			t.Fatalf("prob[%d] = %f out of [0,1]", i, p)
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		word := s.sample()
+		if word != "a" && word != "b" && word != "c" {
+			t.Fatalf("sample returned unexpected word %q", word)
+		}
+	}
+}